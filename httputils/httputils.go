@@ -0,0 +1,12 @@
+package httputils
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+func WriteError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
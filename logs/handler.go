@@ -2,16 +2,88 @@ package logs
 
 import (
 	"context"
+	"encoding/binary"
 	"encoding/json"
-	"log"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/url"
 	"strconv"
 	"time"
 
 	"github.com/openfaas/faas-provider/httputils"
+	"go.opentelemetry.io/otel/attribute"
 )
 
+// Option configures optional middleware, such as rate limiting and retries, applied by
+// NewLogHandlerFunc around the supplied Requestor.
+type Option func(*handlerOptions)
+
+type handlerOptions struct {
+	rateLimitQPS   float64
+	rateLimitBurst int
+	retryPolicy    *RetryPolicy
+	logger         Logger
+	observability  *Observability
+}
+
+// WithObservability wires obs's Prometheus metrics and OpenTelemetry tracer around the handler.
+func WithObservability(obs *Observability) Option {
+	return func(o *handlerOptions) {
+		o.observability = obs
+	}
+}
+
+// WithLogger sets the structured Logger used by the handler, in place of the default Logger
+// returned by NewStdLogger.
+func WithLogger(logger Logger) Option {
+	return func(o *handlerOptions) {
+		o.logger = logger
+	}
+}
+
+// WithRateLimit wraps the handler's Requestor with RateLimitedRequestor, allowing qps queries per
+// second per function name, with bursts up to burst.
+func WithRateLimit(qps float64, burst int) Option {
+	return func(o *handlerOptions) {
+		o.rateLimitQPS = qps
+		o.rateLimitBurst = burst
+	}
+}
+
+// WithRetryPolicy wraps the handler's Requestor with RetryingRequestor, using the given policy.
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(o *handlerOptions) {
+		o.retryPolicy = &policy
+	}
+}
+
+// resolveOptions applies opts and wraps requestor with whichever middleware they configure. The
+// rate limiter wraps first (innermost) and the retry policy wraps it (outermost), so that every
+// retry attempt re-enters the rate limiter too, instead of only the single outermost call.
+// It also resolves the Logger to use, defaulting to NewStdLogger, and the Observability to use,
+// which is nil unless WithObservability is passed.
+func resolveOptions(requestor Requestor, opts []Option) (Requestor, Logger, *Observability) {
+	cfg := &handlerOptions{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	if cfg.rateLimitQPS > 0 {
+		requestor = RateLimitedRequestor(requestor, cfg.rateLimitQPS, cfg.rateLimitBurst)
+	}
+	if cfg.retryPolicy != nil {
+		requestor = RetryingRequestor(requestor, *cfg.retryPolicy)
+	}
+
+	logger := cfg.logger
+	if logger == nil {
+		logger = NewStdLogger()
+	}
+
+	return requestor, logger, cfg.observability
+}
+
 // Requestor submits queries the logging system.
 // This will be passed to the log handler constructor.
 type Requestor interface {
@@ -21,45 +93,219 @@ type Requestor interface {
 	Query(context.Context, Request) (<-chan Message, error)
 }
 
-// NewLogHandlerFunc creates and http HandlerFunc from the supplied log Requestor.
-func NewLogHandlerFunc(requestor Requestor) http.HandlerFunc {
+const (
+	// contentTypeNDJSON is the default response Content-Type, one JSON encoded Message per line.
+	contentTypeNDJSON = "application/x-ndjson"
+	// contentTypeDockerMultiplexed is the Accept header value that selects the Docker multiplexed
+	// stream framing understood by the docker SDK's stdcopy.StdCopy.
+	contentTypeDockerMultiplexed = "application/vnd.docker.multiplexed-stream"
+	// contentTypeEventStream is the Accept header value that selects Server-Sent Events framing.
+	contentTypeEventStream = "text/event-stream"
+)
+
+// docker multiplexed stream frame stream-type bytes, see
+// https://docs.docker.com/engine/api/v1.41/#tag/Container/operation/ContainerAttach
+const (
+	dockerStreamStdout byte = 1
+	dockerStreamStderr byte = 2
+)
+
+// writeDockerFrame writes msg to w using the Docker multiplexed stream framing: a stream-type
+// byte, three padding bytes, a big-endian uint32 payload length, then the payload itself.
+func writeDockerFrame(w http.ResponseWriter, msg Message) error {
+	streamType := dockerStreamStdout
+	if msg.Stream == StreamStderr {
+		streamType = dockerStreamStderr
+	}
+
+	payload := []byte(msg.Text)
+
+	header := make([]byte, 8)
+	header[0] = streamType
+	binary.BigEndian.PutUint32(header[4:], uint32(len(payload)))
+
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	_, err := w.Write(payload)
+	return err
+}
+
+// matchesStream reports whether msg should be included for the stream(s) requested. When
+// neither Stdout nor Stderr is set, both streams are returned.
+func matchesStream(logRequest Request, msg Message) bool {
+	if !logRequest.Stdout && !logRequest.Stderr {
+		return true
+	}
+
+	switch msg.Stream {
+	case StreamStdout:
+		return logRequest.Stdout
+	case StreamStderr:
+		return logRequest.Stderr
+	default:
+		return true
+	}
+}
+
+// inTimeWindow reports whether msg.Timestamp falls within the optional Since/Until window.
+func inTimeWindow(logRequest Request, msg Message) bool {
+	if logRequest.Since != nil && msg.Timestamp.Before(*logRequest.Since) {
+		return false
+	}
+	if logRequest.Until != nil && msg.Timestamp.After(*logRequest.Until) {
+		return false
+	}
+
+	return true
+}
+
+// withTimestamp prefixes msg.Text with its RFC3339Nano timestamp when requested.
+func withTimestamp(logRequest Request, msg Message) Message {
+	if !logRequest.Timestamps {
+		return msg
+	}
+
+	msg.Text = msg.Timestamp.Format(time.RFC3339Nano) + " " + msg.Text
+	return msg
+}
+
+// writeSSEFrame writes msg to w as a Server-Sent Events frame, using the message's UnixNano
+// timestamp as the event id so that clients can resume the stream via Last-Event-ID.
+func writeSSEFrame(w http.ResponseWriter, msg Message) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "event: log\nid: %d\ndata: %s\n\n", msg.Timestamp.UnixNano(), body)
+	return err
+}
+
+// resumeFromLastEventID overrides logRequest.Since from the Last-Event-ID header, if present,
+// so that a reconnecting SSE client resumes the stream where it left off.
+func resumeFromLastEventID(r *http.Request, logRequest Request) Request {
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		return logRequest
+	}
+
+	nanos, err := strconv.ParseInt(lastEventID, 10, 64)
+	if err != nil {
+		return logRequest
+	}
+
+	since := time.Unix(0, nanos)
+	logRequest.Since = &since
+	return logRequest
+}
+
+// NewLogHandlerFunc creates and http HandlerFunc from the supplied log Requestor. Passing
+// WithRateLimit and/or WithRetryPolicy composes the corresponding middleware around requestor
+// automatically. Log lines are written with the default Logger returned by NewStdLogger, unless
+// overridden with WithLogger; see also NewLogHandlerFuncWithLogger and
+// NewLogHandlerFuncWithOptions.
+func NewLogHandlerFunc(requestor Requestor, opts ...Option) http.HandlerFunc {
+	return newLogHandlerFunc(requestor, opts)
+}
+
+// NewLogHandlerFuncWithLogger is equivalent to NewLogHandlerFunc, but uses logger instead of the
+// default Logger for every log line the handler emits.
+func NewLogHandlerFuncWithLogger(requestor Requestor, logger Logger, opts ...Option) http.HandlerFunc {
+	return newLogHandlerFunc(requestor, append(opts, WithLogger(logger)))
+}
+
+// NewLogHandlerFuncWithOptions is equivalent to NewLogHandlerFunc, but records Prometheus metrics
+// and an OpenTelemetry span, as configured on observability, for every request.
+func NewLogHandlerFuncWithOptions(requestor Requestor, observability *Observability, opts ...Option) http.HandlerFunc {
+	return newLogHandlerFunc(requestor, append(opts, WithObservability(observability)))
+}
+
+func newLogHandlerFunc(requestor Requestor, opts []Option) http.HandlerFunc {
+	requestor, logger, observability := resolveOptions(requestor, opts)
+
 	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
 		if r.Body != nil {
 			defer r.Body.Close()
 		}
 
+		ctx, ro := startRequest(r.Context(), observability)
+
+		reqLogger := logger.With(map[string]interface{}{"remote_addr": r.RemoteAddr})
+
 		cn, ok := w.(http.CloseNotifier)
 		if !ok {
-			log.Println("LogHandler: response is not a CloseNotifier, required for streaming response")
+			reqLogger.Errorf("LogHandler: response is not a CloseNotifier, required for streaming response")
+			ro.end(reasonWriterCapError, 0)
 			http.NotFound(w, r)
 			return
 		}
 		flusher, ok := w.(http.Flusher)
 		if !ok {
-			log.Println("LogHandler: response is not a Flusher, required for streaming response")
+			reqLogger.Errorf("LogHandler: response is not a Flusher, required for streaming response")
+			ro.end(reasonWriterCapError, 0)
 			http.NotFound(w, r)
 			return
 		}
 
 		logRequest, err := parseRequest(r)
 		if err != nil {
-			w.WriteHeader(http.StatusUnprocessableEntity)
+			reqLogger.With(map[string]interface{}{"err": err}).Errorf("LogHandler: could not parse the log request")
+			ro.end(reasonParseError, 0)
 			httputils.WriteError(w, http.StatusUnprocessableEntity, "could not parse the log request")
 			return
 		}
+		ro.setFunction(logRequest.Name)
+		ro.event("parseRequest")
+
+		reqLogger = reqLogger.With(map[string]interface{}{
+			"function": logRequest.Name,
+			"instance": logRequest.Instance,
+			"limit":    logRequest.Limit,
+			"follow":   logRequest.Follow,
+		})
+
+		accept := r.Header.Get("Accept")
+		dockerFraming := accept == contentTypeDockerMultiplexed
+		sseFraming := accept == contentTypeEventStream
+		if sseFraming {
+			logRequest = resumeFromLastEventID(r, logRequest)
+		}
 
-		ctx, cancelQuery := context.WithCancel(r.Context())
+		ctx, cancelQuery := context.WithCancel(ctx)
 		defer cancelQuery()
 		messages, err := requestor.Query(ctx, logRequest)
+		ro.event("query")
 		if err != nil {
+			var throttled *ThrottledError
+			if errors.As(err, &throttled) {
+				reqLogger.Warnf("LogHandler: throttled function log request")
+				ro.end(reasonThrottled, 0)
+				w.Header().Set("Retry-After", strconv.Itoa(int(throttled.RetryAfter.Seconds()+1)))
+				httputils.WriteError(w, http.StatusTooManyRequests, "function log request throttled")
+				return
+			}
+
 			// add smarter error handling here
+			reqLogger.With(map[string]interface{}{"err": err}).Errorf("LogHandler: function log request failed")
+			ro.end(reasonQueryError, 0)
 			httputils.WriteError(w, http.StatusInternalServerError, "function log request failed")
 			return
 		}
 
 		// Send the initial headers saying we're gonna stream the response.
 		w.Header().Set("Transfer-Encoding", "chunked")
-		w.Header().Set(http.CanonicalHeaderKey("Content-Type"), "application/x-ndjson")
+		switch {
+		case dockerFraming:
+			w.Header().Set(http.CanonicalHeaderKey("Content-Type"), contentTypeDockerMultiplexed)
+		case sseFraming:
+			w.Header().Set(http.CanonicalHeaderKey("Content-Type"), contentTypeEventStream)
+			w.Header().Set("Cache-Control", "no-cache")
+		default:
+			w.Header().Set(http.CanonicalHeaderKey("Content-Type"), contentTypeNDJSON)
+		}
 		w.WriteHeader(http.StatusOK)
 		flusher.Flush()
 
@@ -67,17 +313,43 @@ func NewLogHandlerFunc(requestor Requestor) http.HandlerFunc {
 		jsonEncoder := json.NewEncoder(w)
 
 		if logRequest.Limit > 0 {
-			log.Printf("LogHandler: watch for and stream `%d` log messages\n", logRequest.Limit)
+			reqLogger.Infof("LogHandler: watch for and stream log messages")
 		}
 
+		// A non-Follow query with Tail set is buffered instead of written as messages arrive, so
+		// that only the last Tail messages are sent once the Requestor's stream closes; Follow
+		// queries have no "end" to tail from, so Tail is ignored for them.
+		bufferTail := logRequest.Tail > 0 && !logRequest.Follow
+		var tailBuffer []Message
+
 		for messages != nil {
 			select {
 			case <-cn.CloseNotify():
-				log.Println("LogHandler: client stopped listening")
+				reqLogger.With(map[string]interface{}{
+					"sent":        sent,
+					"duration_ms": time.Since(start).Milliseconds(),
+				}).Infof("LogHandler: client stopped listening")
+				ro.end(reasonClientClosed, sent)
 				return
 			case msg, ok := <-messages:
 				if !ok {
-					log.Println("LogHandler: end of log stream")
+					for _, tailMsg := range tailBuffer {
+						if err := writeMessage(w, jsonEncoder, dockerFraming, sseFraming, tailMsg); err != nil {
+							reqLogger.With(map[string]interface{}{"err": err}).Errorf("LogHandler: failed to serialize log message: '%s'", tailMsg.String())
+							ro.end(reasonEncodeError, sent)
+							jsonEncoder.Encode(Message{Text: "failed to serialize log message"})
+							return
+						}
+						flusher.Flush()
+						sent++
+						ro.event("flush", attribute.Int("sent", sent))
+					}
+
+					reqLogger.With(map[string]interface{}{
+						"sent":        sent,
+						"duration_ms": time.Since(start).Milliseconds(),
+					}).Infof("LogHandler: end of log stream")
+					ro.end(reasonUpstreamEOF, sent)
 					messages = nil
 					return
 				}
@@ -85,25 +357,41 @@ func NewLogHandlerFunc(requestor Requestor) http.HandlerFunc {
 				if !requestor.Filter(logRequest, msg) {
 					continue
 				}
+				if !PatternFilter(logRequest, msg) {
+					continue
+				}
+				if !matchesStream(logRequest, msg) || !inTimeWindow(logRequest, msg) {
+					continue
+				}
+				msg = withTimestamp(logRequest, msg)
+
+				if bufferTail {
+					tailBuffer = appendTail(tailBuffer, msg, logRequest.Tail)
+					continue
+				}
+
 				// serialize and write the msg to the http ResponseWriter
-				err := jsonEncoder.Encode(msg)
-				if err != nil {
+				if err := writeMessage(w, jsonEncoder, dockerFraming, sseFraming, msg); err != nil {
 					// can't actually write the status header here so we should json serialize an error
 					// and return that because we have already sent the content type and status code
-					log.Printf("LogHandler: failed to serialize log message: '%s'\n", msg.String())
+					reqLogger.With(map[string]interface{}{"err": err}).Errorf("LogHandler: failed to serialize log message: '%s'", msg.String())
+					ro.end(reasonEncodeError, sent)
 					// write json error message here ?
 					jsonEncoder.Encode(Message{Text: "failed to serialize log message"})
 					return
 				}
 
 				flusher.Flush()
+				sent++
+				ro.event("flush", attribute.Int("sent", sent))
 
-				if logRequest.Limit > 0 {
-					sent++
-					if sent >= logRequest.Limit {
-						log.Printf("LogHandler: reached message limit '%d'\n", logRequest.Limit)
-						return
-					}
+				if logRequest.Limit > 0 && sent >= logRequest.Limit {
+					reqLogger.With(map[string]interface{}{
+						"sent":        sent,
+						"duration_ms": time.Since(start).Milliseconds(),
+					}).Infof("LogHandler: reached message limit")
+					ro.end(reasonLimitReached, sent)
+					return
 				}
 			}
 		}
@@ -112,6 +400,29 @@ func NewLogHandlerFunc(requestor Requestor) http.HandlerFunc {
 	}
 }
 
+// writeMessage serializes msg to w using the framing selected by dockerFraming/sseFraming,
+// defaulting to one JSON-encoded Message per line via jsonEncoder.
+func writeMessage(w http.ResponseWriter, jsonEncoder *json.Encoder, dockerFraming, sseFraming bool, msg Message) error {
+	switch {
+	case dockerFraming:
+		return writeDockerFrame(w, msg)
+	case sseFraming:
+		return writeSSEFrame(w, msg)
+	default:
+		return jsonEncoder.Encode(msg)
+	}
+}
+
+// appendTail appends msg to buffer, evicting the oldest entry once buffer holds more than max
+// messages, so that buffer always holds at most the last max messages seen.
+func appendTail(buffer []Message, msg Message, max int) []Message {
+	buffer = append(buffer, msg)
+	if len(buffer) > max {
+		buffer = buffer[len(buffer)-max:]
+	}
+	return buffer
+}
+
 // parseRequest extracts the logRequest from the GET variables or from the POST body
 func parseRequest(r *http.Request) (logRequest Request, err error) {
 	switch r.Method {
@@ -129,6 +440,17 @@ func parseRequest(r *http.Request) (logRequest Request, err error) {
 		// ignore error because it will default to false if we can't parse it
 		logRequest.Follow, _ = strconv.ParseBool(getValue(query, "follow"))
 		logRequest.Invert, _ = strconv.ParseBool(getValue(query, "invert"))
+		logRequest.Stdout, _ = strconv.ParseBool(getValue(query, "stdout"))
+		logRequest.Stderr, _ = strconv.ParseBool(getValue(query, "stderr"))
+		logRequest.Timestamps, _ = strconv.ParseBool(getValue(query, "timestamps"))
+
+		tailStr := getValue(query, "tail")
+		if tailStr != "" {
+			logRequest.Tail, err = strconv.Atoi(tailStr)
+			if err != nil {
+				return logRequest, err
+			}
+		}
 
 		sinceStr := getValue(query, "since")
 		if sinceStr != "" {
@@ -139,6 +461,15 @@ func parseRequest(r *http.Request) (logRequest Request, err error) {
 			}
 		}
 
+		untilStr := getValue(query, "until")
+		if untilStr != "" {
+			until, err := time.Parse(time.RFC3339, untilStr)
+			logRequest.Until = &until
+			if err != nil {
+				return logRequest, err
+			}
+		}
+
 		// don't use getValue here so that we can detect if the value is nil or empty
 		patterns := query["pattern"]
 		if len(patterns) > 0 {
@@ -148,8 +479,17 @@ func parseRequest(r *http.Request) (logRequest Request, err error) {
 	case http.MethodPost:
 		err = json.NewDecoder(r.Body).Decode(&logRequest)
 	}
+	if err != nil {
+		return logRequest, err
+	}
+
+	// compile the pattern up front so malformed or overly expensive patterns are rejected before
+	// any log message is streamed, and so it is not re-compiled for every message.
+	if _, err := logRequest.Compile(); err != nil {
+		return logRequest, err
+	}
 
-	return logRequest, err
+	return logRequest, nil
 }
 
 // getValue returns the value for the given key. If the key has more than one value, it returns the
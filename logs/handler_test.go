@@ -1,8 +1,13 @@
 package logs
 
 import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
 	"testing"
 	"time"
 )
@@ -54,6 +59,19 @@ func Test_GETRequestParsing(t *testing.T) {
 				Invert:   true,
 			},
 		},
+		{
+			name:        "stream selection, timestamps, tail and until",
+			rawQueryStr: "name=foobar&until=2019-02-16T09%3A10%3A06%2B00%3A00&stdout=true&stderr=true&timestamps=true&tail=20",
+			err:         "",
+			expectedRequest: Request{
+				Name:       "foobar",
+				Until:      &sinceTime,
+				Stdout:     true,
+				Stderr:     true,
+				Timestamps: true,
+				Tail:       20,
+			},
+		},
 	}
 
 	req := httptest.NewRequest(http.MethodGet, "/", nil)
@@ -71,6 +89,192 @@ func Test_GETRequestParsing(t *testing.T) {
 	}
 }
 
+func Test_ResumeFromLastEventID(t *testing.T) {
+	since := time.Date(2019, 2, 16, 9, 10, 6, 0, time.UTC)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Last-Event-ID", strconv.FormatInt(since.UnixNano(), 10))
+
+	logRequest := resumeFromLastEventID(req, Request{Name: "foobar"})
+	if logRequest.Since == nil || !logRequest.Since.Equal(since) {
+		t.Errorf("expected Since to be set from Last-Event-ID to %s, got: %v", since, logRequest.Since)
+	}
+}
+
+func Test_WriteDockerFrame(t *testing.T) {
+	scenarios := []struct {
+		name       string
+		msg        Message
+		streamType byte
+	}{
+		{name: "stdout defaults to stream type 1", msg: Message{Text: "hello"}, streamType: dockerStreamStdout},
+		{name: "explicit stdout uses stream type 1", msg: Message{Text: "hello", Stream: StreamStdout}, streamType: dockerStreamStdout},
+		{name: "stderr uses stream type 2", msg: Message{Text: "hello", Stream: StreamStderr}, streamType: dockerStreamStderr},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			if err := writeDockerFrame(w, s.msg); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			body := w.Body.Bytes()
+			if len(body) != 8+len(s.msg.Text) {
+				t.Fatalf("expected an 8 byte header plus payload, got %d bytes", len(body))
+			}
+
+			if body[0] != s.streamType {
+				t.Errorf("expected stream type byte %d, got %d", s.streamType, body[0])
+			}
+
+			length := binary.BigEndian.Uint32(body[4:8])
+			if int(length) != len(s.msg.Text) {
+				t.Errorf("expected payload length %d, got %d", len(s.msg.Text), length)
+			}
+
+			if string(body[8:]) != s.msg.Text {
+				t.Errorf("expected payload %q, got %q", s.msg.Text, string(body[8:]))
+			}
+		})
+	}
+}
+
+func Test_MatchesStream(t *testing.T) {
+	scenarios := []struct {
+		name    string
+		req     Request
+		msg     Message
+		matches bool
+	}{
+		{name: "no stream filter matches stdout", req: Request{}, msg: Message{Stream: StreamStdout}, matches: true},
+		{name: "no stream filter matches stderr", req: Request{}, msg: Message{Stream: StreamStderr}, matches: true},
+		{name: "stdout only excludes stderr", req: Request{Stdout: true}, msg: Message{Stream: StreamStderr}, matches: false},
+		{name: "stdout only includes stdout", req: Request{Stdout: true}, msg: Message{Stream: StreamStdout}, matches: true},
+		{name: "stderr only excludes stdout", req: Request{Stderr: true}, msg: Message{Stream: StreamStdout}, matches: false},
+		{name: "both selected includes both", req: Request{Stdout: true, Stderr: true}, msg: Message{Stream: StreamStderr}, matches: true},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			if got := matchesStream(s.req, s.msg); got != s.matches {
+				t.Errorf("expected matchesStream to return %t, got %t", s.matches, got)
+			}
+		})
+	}
+}
+
+func Test_InTimeWindow(t *testing.T) {
+	since := time.Date(2019, 2, 16, 9, 0, 0, 0, time.UTC)
+	until := time.Date(2019, 2, 16, 10, 0, 0, 0, time.UTC)
+
+	scenarios := []struct {
+		name      string
+		req       Request
+		timestamp time.Time
+		inWindow  bool
+	}{
+		{name: "no window always matches", req: Request{}, timestamp: since.Add(-time.Hour), inWindow: true},
+		{name: "before since is excluded", req: Request{Since: &since}, timestamp: since.Add(-time.Second), inWindow: false},
+		{name: "at since is included", req: Request{Since: &since}, timestamp: since, inWindow: true},
+		{name: "after until is excluded", req: Request{Until: &until}, timestamp: until.Add(time.Second), inWindow: false},
+		{name: "at until is included", req: Request{Until: &until}, timestamp: until, inWindow: true},
+		{name: "within since and until is included", req: Request{Since: &since, Until: &until}, timestamp: since.Add(time.Minute), inWindow: true},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			msg := Message{Timestamp: s.timestamp}
+			if got := inTimeWindow(s.req, msg); got != s.inWindow {
+				t.Errorf("expected inTimeWindow to return %t, got %t", s.inWindow, got)
+			}
+		})
+	}
+}
+
+func Test_WithTimestamp(t *testing.T) {
+	timestamp := time.Date(2019, 2, 16, 9, 10, 6, 0, time.UTC)
+	msg := Message{Text: "hello", Timestamp: timestamp}
+
+	unchanged := withTimestamp(Request{}, msg)
+	if unchanged.Text != "hello" {
+		t.Errorf("expected Text to be unchanged when Timestamps is false, got: %q", unchanged.Text)
+	}
+
+	prefixed := withTimestamp(Request{Timestamps: true}, msg)
+	expected := timestamp.Format(time.RFC3339Nano) + " hello"
+	if prefixed.Text != expected {
+		t.Errorf("expected Text %q, got %q", expected, prefixed.Text)
+	}
+}
+
+func Test_WriteSSEFrame(t *testing.T) {
+	timestamp := time.Date(2019, 2, 16, 9, 10, 6, 0, time.UTC)
+	msg := Message{Name: "foobar", Text: "hello"}
+	msg.Timestamp = timestamp
+
+	w := httptest.NewRecorder()
+	if err := writeSSEFrame(w, msg); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	expected := "event: log\nid: " + strconv.FormatInt(timestamp.UnixNano(), 10) + "\ndata: {\"name\":\"foobar\",\"instance\":\"\",\"timestamp\":\"2019-02-16T09:10:06Z\",\"text\":\"hello\"}\n\n"
+	if w.Body.String() != expected {
+		t.Errorf("expected SSE frame:\n%q\ngot:\n%q", expected, w.Body.String())
+	}
+}
+
+// handlerTestRequestor streams the given messages then closes, as a non-Follow query would once
+// the backend has no more logs to return.
+type handlerTestRequestor struct {
+	messages []Message
+}
+
+func (r *handlerTestRequestor) Filter(Request, Message) bool { return true }
+
+func (r *handlerTestRequestor) Query(ctx context.Context, req Request) (<-chan Message, error) {
+	out := make(chan Message, len(r.messages))
+	for _, msg := range r.messages {
+		out <- msg
+	}
+	close(out)
+
+	return out, nil
+}
+
+func Test_NewLogHandlerFunc_Tail(t *testing.T) {
+	requestor := &handlerTestRequestor{
+		messages: []Message{
+			{Name: "foobar", Text: "one"},
+			{Name: "foobar", Text: "two"},
+			{Name: "foobar", Text: "three"},
+		},
+	}
+
+	server := httptest.NewServer(NewLogHandlerFunc(requestor))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/?name=foobar&tail=2")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer resp.Body.Close()
+
+	var got []string
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		var msg Message
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		got = append(got, msg.Text)
+	}
+
+	if len(got) != 2 || got[0] != "two" || got[1] != "three" {
+		t.Errorf("expected only the last 2 messages [two three], got: %v", got)
+	}
+}
+
 func equalError(t *testing.T, expected string, actual error) {
 	if expected == "" && actual == nil {
 		return
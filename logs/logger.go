@@ -0,0 +1,74 @@
+package logs
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+)
+
+// Logger is the structured logging interface used by the log handler, so that provider
+// integrators can plug in logrus/zap/zerolog (or inject request-id correlation from their own
+// middleware) instead of the handler writing free-form text via the standard log package.
+type Logger interface {
+	Debugf(format string, args ...interface{})
+	Infof(format string, args ...interface{})
+	Warnf(format string, args ...interface{})
+	Errorf(format string, args ...interface{})
+	// With returns a Logger that includes fields on every subsequent log line.
+	With(fields map[string]interface{}) Logger
+}
+
+// stdLogger is the default Logger, used when NewLogHandlerFunc is not given one explicitly. It
+// writes to the standard log package, appending fields as "key=value" pairs.
+type stdLogger struct {
+	fields map[string]interface{}
+}
+
+// NewStdLogger returns the default Logger, which writes structured fields to the standard log
+// package.
+func NewStdLogger() Logger {
+	return &stdLogger{}
+}
+
+func (l *stdLogger) Debugf(format string, args ...interface{}) { l.logf("DEBUG", format, args...) }
+func (l *stdLogger) Infof(format string, args ...interface{})  { l.logf("INFO", format, args...) }
+func (l *stdLogger) Warnf(format string, args ...interface{})  { l.logf("WARN", format, args...) }
+func (l *stdLogger) Errorf(format string, args ...interface{}) { l.logf("ERROR", format, args...) }
+
+func (l *stdLogger) With(fields map[string]interface{}) Logger {
+	merged := make(map[string]interface{}, len(l.fields)+len(fields))
+	for k, v := range l.fields {
+		merged[k] = v
+	}
+	for k, v := range fields {
+		merged[k] = v
+	}
+
+	return &stdLogger{fields: merged}
+}
+
+func (l *stdLogger) logf(level, format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	if len(l.fields) > 0 {
+		msg = msg + " " + formatFields(l.fields)
+	}
+
+	log.Printf("%s %s", level, msg)
+}
+
+// formatFields renders fields as sorted "key=value" pairs so log output is stable and greppable.
+func formatFields(fields map[string]interface{}) string {
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		pairs = append(pairs, fmt.Sprintf("%s=%v", k, fields[k]))
+	}
+
+	return strings.Join(pairs, " ")
+}
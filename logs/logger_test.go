@@ -0,0 +1,26 @@
+package logs
+
+import "testing"
+
+func Test_FormatFields(t *testing.T) {
+	got := formatFields(map[string]interface{}{"b": 2, "a": "one"})
+	want := "a=one b=2"
+
+	if got != want {
+		t.Errorf("expected fields to be sorted by key, expected: %q, got: %q", want, got)
+	}
+}
+
+func Test_StdLogger_With_MergesFields(t *testing.T) {
+	base := NewStdLogger().With(map[string]interface{}{"function": "foobar"})
+	merged := base.With(map[string]interface{}{"sent": 3})
+
+	withLogger, ok := merged.(*stdLogger)
+	if !ok {
+		t.Fatalf("expected *stdLogger, got: %T", merged)
+	}
+
+	if withLogger.fields["function"] != "foobar" || withLogger.fields["sent"] != 3 {
+		t.Errorf("expected merged fields to include both parent and child fields, got: %v", withLogger.fields)
+	}
+}
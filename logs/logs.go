@@ -4,6 +4,7 @@ package logs
 
 import (
 	"fmt"
+	"regexp"
 	"time"
 )
 
@@ -30,6 +31,23 @@ type Request struct {
 	Pattern *string `json:"pattern"`
 	// Invert allows you to control if the Pattern should be matched or negated
 	Invert bool `json:"invert"`
+	// Stdout allows the caller to request only the stdout stream, it may be combined with Stderr
+	Stdout bool `json:"stdout"`
+	// Stderr allows the caller to request only the stderr stream, it may be combined with Stdout
+	Stderr bool `json:"stderr"`
+	// Timestamps requests that each log line is prefixed with its RFC3339Nano timestamp
+	Timestamps bool `json:"timestamps"`
+	// Tail sets the number of lines to show from the end of the logs, <=0 means show all logs.
+	// NewLogHandlerFunc enforces this for non-Follow queries by buffering up to the last Tail
+	// messages and writing them once the Requestor's stream closes; it is ignored for Follow
+	// queries, since a tail is not expected to have an end to count back from.
+	Tail int `json:"tail"`
+	// Until is the optional datetime value to stop the logs at
+	Until *time.Time `json:"until"`
+
+	// compiled caches the result of Compile, so that Pattern is parsed at most once per request
+	// rather than once per log message.
+	compiled *regexp.Regexp
 }
 
 // Message is a specific log message from a function container log stream
@@ -42,8 +60,37 @@ type Message struct {
 	Timestamp time.Time `json:"timestamp"`
 	// Text is the raw log message content
 	Text string `json:"text"`
+	// Stream indicates which container stream the message was read from, "stdout" or "stderr"
+	Stream string `json:"stream,omitempty"`
 }
 
+const (
+	// StreamStdout is the Message.Stream value for messages read from the container's stdout
+	StreamStdout = "stdout"
+	// StreamStderr is the Message.Stream value for messages read from the container's stderr
+	StreamStderr = "stderr"
+)
+
 func (m Message) String() string {
 	return fmt.Sprintf("%s %s (%s) %s", m.Timestamp.String(), m.Name, m.Instance, m.Text)
 }
+
+func (req Request) String() string {
+	var since, until string
+	if req.Since != nil {
+		since = req.Since.String()
+	}
+	if req.Until != nil {
+		until = req.Until.String()
+	}
+
+	var pattern string
+	if req.Pattern != nil {
+		pattern = *req.Pattern
+	}
+
+	return fmt.Sprintf(
+		"Request{Name:%s Instance:%s Since:%s Until:%s Limit:%d Tail:%d Follow:%t Pattern:%s Invert:%t Stdout:%t Stderr:%t Timestamps:%t}",
+		req.Name, req.Instance, since, until, req.Limit, req.Tail, req.Follow, pattern, req.Invert, req.Stdout, req.Stderr, req.Timestamps,
+	)
+}
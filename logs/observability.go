@@ -0,0 +1,153 @@
+package logs
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// terminal reasons a log request can end with, recorded as a span event and, for
+// faas_logs_requests_total, as the status label.
+const (
+	reasonLimitReached   = "limit_reached"
+	reasonClientClosed   = "client_closed"
+	reasonUpstreamEOF    = "upstream_eof"
+	reasonEncodeError    = "encode_error"
+	reasonParseError     = "parse_error"
+	reasonQueryError     = "query_error"
+	reasonThrottled      = "throttled"
+	reasonWriterCapError = "writer_capability_error"
+	// reasonUpgradeError is NewLogWebsocketHandler's equivalent of reasonWriterCapError: the
+	// websocket handshake itself failed, rather than the function log query or a later write.
+	reasonUpgradeError = "upgrade_error"
+)
+
+// Metrics holds the Prometheus collectors the log handler records to, when an Observability with
+// Metrics set is passed to NewLogHandlerFuncWithOptions.
+type Metrics struct {
+	// RequestsTotal counts log requests by function and terminal status.
+	RequestsTotal *prometheus.CounterVec
+	// MessagesStreamedTotal counts log messages forwarded to clients, by function.
+	MessagesStreamedTotal *prometheus.CounterVec
+	// StreamDuration observes how long a log request stays open, by function.
+	StreamDuration *prometheus.HistogramVec
+	// ClientDisconnectsTotal counts requests terminated by the client disconnecting, by function.
+	ClientDisconnectsTotal *prometheus.CounterVec
+}
+
+// NewMetrics creates the Metrics collectors used by the log handler. Call Register to expose them
+// on a Prometheus registry.
+func NewMetrics() *Metrics {
+	return &Metrics{
+		RequestsTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "faas_logs_requests_total",
+			Help: "Total number of log requests handled, partitioned by function and terminal status.",
+		}, []string{"function", "status"}),
+		MessagesStreamedTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "faas_logs_messages_streamed_total",
+			Help: "Total number of log messages streamed to clients, partitioned by function.",
+		}, []string{"function"}),
+		StreamDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name: "faas_logs_stream_duration_seconds",
+			Help: "Duration in seconds that a log streaming request stayed open, partitioned by function.",
+		}, []string{"function"}),
+		ClientDisconnectsTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "faas_logs_client_disconnects_total",
+			Help: "Total number of log requests terminated by the client disconnecting, partitioned by function.",
+		}, []string{"function"}),
+	}
+}
+
+// Register adds m's collectors to registerer.
+func (m *Metrics) Register(registerer prometheus.Registerer) error {
+	collectors := []prometheus.Collector{
+		m.RequestsTotal,
+		m.MessagesStreamedTotal,
+		m.StreamDuration,
+		m.ClientDisconnectsTotal,
+	}
+
+	for _, c := range collectors {
+		if err := registerer.Register(c); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Observability bundles the optional Prometheus metrics and OpenTelemetry tracer that
+// NewLogHandlerFuncWithOptions wires around every log request.
+type Observability struct {
+	// Metrics, when set, records request/message counters and stream duration.
+	Metrics *Metrics
+	// Tracer, when set, wraps each request in a span covering parseRequest, Requestor.Query and
+	// the streaming loop, with span events on flushes and the terminal reason.
+	Tracer trace.Tracer
+}
+
+// requestObservability tracks the span and metrics for a single log request.
+type requestObservability struct {
+	obs      *Observability
+	span     trace.Span
+	function string
+	start    time.Time
+}
+
+// startRequest begins a span, if obs has a Tracer configured, and returns the context to use for
+// the rest of the request along with a requestObservability used to record events and metrics.
+func startRequest(ctx context.Context, obs *Observability) (context.Context, *requestObservability) {
+	ro := &requestObservability{obs: obs, start: time.Now()}
+	if obs == nil || obs.Tracer == nil {
+		return ctx, ro
+	}
+
+	ctx, ro.span = obs.Tracer.Start(ctx, "LogHandler")
+	return ctx, ro
+}
+
+// setFunction records the function name on the span and on every metric this request emits, once
+// it becomes known after parseRequest.
+func (ro *requestObservability) setFunction(function string) {
+	ro.function = function
+	if ro.span != nil {
+		ro.span.SetAttributes(attribute.String("function", function))
+	}
+}
+
+// event records a span event, a no-op when tracing is not configured.
+func (ro *requestObservability) event(name string, attrs ...attribute.KeyValue) {
+	if ro.span != nil {
+		ro.span.AddEvent(name, trace.WithAttributes(attrs...))
+	}
+}
+
+// end records the terminal reason as a span event, ends the span, and records
+// faas_logs_requests_total, faas_logs_messages_streamed_total, faas_logs_stream_duration_seconds
+// and, for a client disconnect, faas_logs_client_disconnects_total.
+func (ro *requestObservability) end(reason string, sent int) {
+	ro.event("stream.end", attribute.String("reason", reason), attribute.Int("sent", sent))
+
+	if ro.span != nil {
+		if reason == reasonParseError || reason == reasonQueryError || reason == reasonEncodeError || reason == reasonWriterCapError || reason == reasonUpgradeError {
+			ro.span.SetStatus(codes.Error, reason)
+		}
+		ro.span.End()
+	}
+
+	if ro.obs == nil || ro.obs.Metrics == nil {
+		return
+	}
+
+	m := ro.obs.Metrics
+	m.RequestsTotal.WithLabelValues(ro.function, reason).Inc()
+	m.MessagesStreamedTotal.WithLabelValues(ro.function).Add(float64(sent))
+	m.StreamDuration.WithLabelValues(ro.function).Observe(time.Since(ro.start).Seconds())
+	if reason == reasonClientClosed {
+		m.ClientDisconnectsTotal.WithLabelValues(ro.function).Inc()
+	}
+}
@@ -0,0 +1,67 @@
+package logs
+
+import (
+	"context"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func Test_RequestObservability_End_RecordsMetrics(t *testing.T) {
+	metrics := NewMetrics()
+	obs := &Observability{Metrics: metrics}
+
+	_, ro := startRequest(context.Background(), obs)
+	ro.setFunction("foobar")
+	ro.end(reasonLimitReached, 3)
+
+	metric := &dto.Metric{}
+	counter, err := metrics.RequestsTotal.GetMetricWithLabelValues("foobar", reasonLimitReached)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := counter.(prometheus.Metric).Write(metric); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if metric.GetCounter().GetValue() != 1 {
+		t.Errorf("expected faas_logs_requests_total{foobar,limit_reached} to be 1, got: %v", metric.GetCounter().GetValue())
+	}
+
+	metric = &dto.Metric{}
+	msgCounter, err := metrics.MessagesStreamedTotal.GetMetricWithLabelValues("foobar")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := msgCounter.(prometheus.Metric).Write(metric); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if metric.GetCounter().GetValue() != 3 {
+		t.Errorf("expected faas_logs_messages_streamed_total{foobar} to be 3, got: %v", metric.GetCounter().GetValue())
+	}
+}
+
+func Test_RequestObservability_End_DistinguishesWriterCapabilityFromParseError(t *testing.T) {
+	metrics := NewMetrics()
+	obs := &Observability{Metrics: metrics}
+
+	_, ro := startRequest(context.Background(), obs)
+	ro.setFunction("foobar")
+	ro.end(reasonWriterCapError, 0)
+
+	metric := &dto.Metric{}
+	counter, err := metrics.RequestsTotal.GetMetricWithLabelValues("foobar", reasonWriterCapError)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := counter.(prometheus.Metric).Write(metric); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if metric.GetCounter().GetValue() != 1 {
+		t.Errorf("expected faas_logs_requests_total{foobar,writer_capability_error} to be 1, got: %v", metric.GetCounter().GetValue())
+	}
+
+	if reasonWriterCapError == reasonParseError {
+		t.Errorf("expected a distinct reason constant from reasonParseError")
+	}
+}
@@ -0,0 +1,73 @@
+package logs
+
+import (
+	"fmt"
+	"regexp"
+	"regexp/syntax"
+)
+
+const (
+	// MaxPatternLength is the maximum number of characters allowed in a Request.Pattern. Longer
+	// patterns are rejected by Compile before they are ever evaluated.
+	MaxPatternLength = 256
+
+	// maxPatternProgramSize bounds the number of instructions a compiled Pattern may expand to,
+	// so that a pattern built from unbounded repetition/alternation (e.g. "(.*){100}") cannot be
+	// used to exhaust CPU on every log message streamed through the provider.
+	maxPatternProgramSize = 1000
+)
+
+// Compile parses and validates req.Pattern, returning the compiled regexp. It returns a nil
+// regexp and nil error when Pattern is unset. The result is cached on the Request, so repeated
+// calls - such as one per streamed Message - do not re-compile the pattern.
+func (req *Request) Compile() (*regexp.Regexp, error) {
+	if req.Pattern == nil {
+		return nil, nil
+	}
+	if req.compiled != nil {
+		return req.compiled, nil
+	}
+
+	pattern := *req.Pattern
+	if len(pattern) > MaxPatternLength {
+		return nil, fmt.Errorf("pattern exceeds the maximum allowed length of %d characters", MaxPatternLength)
+	}
+
+	parsed, err := syntax.Parse(pattern, syntax.Perl)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern: %w", err)
+	}
+
+	prog, err := syntax.Compile(parsed)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern: %w", err)
+	}
+	if len(prog.Inst) > maxPatternProgramSize {
+		return nil, fmt.Errorf("pattern is too complex, it compiles to %d instructions, the maximum allowed is %d", len(prog.Inst), maxPatternProgramSize)
+	}
+
+	compiled, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern: %w", err)
+	}
+
+	req.compiled = compiled
+	return compiled, nil
+}
+
+// PatternFilter is the default server side Pattern filter. NewLogHandlerFunc applies it whenever
+// the supplied Requestor.Filter allows a Message through, so that a Requestor does not need to
+// implement its own Pattern matching unless it wants to replace this behaviour entirely.
+func PatternFilter(req Request, msg Message) bool {
+	compiled, err := req.Compile()
+	if err != nil || compiled == nil {
+		return true
+	}
+
+	matched := compiled.MatchString(msg.Text)
+	if req.Invert {
+		return !matched
+	}
+
+	return matched
+}
@@ -0,0 +1,72 @@
+package logs
+
+import (
+	"strings"
+	"testing"
+)
+
+func Test_Request_Compile(t *testing.T) {
+	pattern := "^200.*"
+	req := Request{Pattern: &pattern}
+
+	compiled, err := req.Compile()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !compiled.MatchString("200 OK") {
+		t.Errorf("expected compiled pattern to match")
+	}
+
+	// a second call must return the cached regexp rather than recompiling.
+	again, err := req.Compile()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if again != compiled {
+		t.Errorf("expected the second Compile call to return the cached *regexp.Regexp")
+	}
+}
+
+func Test_Request_Compile_RejectsOversizedPattern(t *testing.T) {
+	pattern := strings.Repeat("a", MaxPatternLength+1)
+	req := Request{Pattern: &pattern}
+
+	if _, err := req.Compile(); err == nil {
+		t.Errorf("expected an error for a pattern longer than MaxPatternLength")
+	}
+}
+
+func Test_Request_Compile_RejectsExpensivePattern(t *testing.T) {
+	pattern := strings.Repeat("(.*)", 300)
+	req := Request{Pattern: &pattern}
+
+	if _, err := req.Compile(); err == nil {
+		t.Errorf("expected an error for a pattern that compiles to too many instructions")
+	}
+}
+
+func Test_PatternFilter(t *testing.T) {
+	pattern := "^error"
+
+	scenarios := []struct {
+		name   string
+		req    Request
+		text   string
+		expect bool
+	}{
+		{name: "no pattern matches everything", req: Request{}, text: "anything", expect: true},
+		{name: "matching pattern", req: Request{Pattern: &pattern}, text: "error: boom", expect: true},
+		{name: "non-matching pattern", req: Request{Pattern: &pattern}, text: "info: ok", expect: false},
+		{name: "inverted matching pattern", req: Request{Pattern: &pattern, Invert: true}, text: "error: boom", expect: false},
+		{name: "inverted non-matching pattern", req: Request{Pattern: &pattern, Invert: true}, text: "info: ok", expect: true},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			got := PatternFilter(s.req, Message{Text: s.text})
+			if got != s.expect {
+				t.Errorf("expected PatternFilter to return %v, got: %v", s.expect, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,240 @@
+package logs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// longThrottleLatency is the default delay above which a throttled query is rejected instead of
+// being held open, mirroring the behaviour of k8s client-go's REST layer.
+const longThrottleLatency = 50 * time.Millisecond
+
+// ThrottledError is returned by a rate limited Requestor when a query cannot proceed without
+// waiting longer than the configured longThrottleLatency. Callers can use this to surface a
+// Retry-After header instead of blocking the request.
+type ThrottledError struct {
+	// RetryAfter is how long the caller should wait before retrying the query.
+	RetryAfter time.Duration
+}
+
+func (e *ThrottledError) Error() string {
+	return fmt.Sprintf("log query throttled, retry after %s", e.RetryAfter)
+}
+
+// rateLimitedRequestor wraps a Requestor with a per-function token bucket rate limiter.
+type rateLimitedRequestor struct {
+	inner Requestor
+	qps   float64
+	burst int
+
+	mu       sync.Mutex
+	limiters map[string]*rate.Limiter
+}
+
+// RateLimitedRequestor wraps inner with a token-bucket rate limiter keyed by function name,
+// allowing qps queries per second with bursts up to burst. Queries that would need to wait
+// longer than longThrottleLatency are rejected with a *ThrottledError instead of being delayed.
+func RateLimitedRequestor(inner Requestor, qps float64, burst int) Requestor {
+	return &rateLimitedRequestor{
+		inner:    inner,
+		qps:      qps,
+		burst:    burst,
+		limiters: map[string]*rate.Limiter{},
+	}
+}
+
+func (r *rateLimitedRequestor) Filter(req Request, msg Message) bool {
+	return r.inner.Filter(req, msg)
+}
+
+func (r *rateLimitedRequestor) Query(ctx context.Context, req Request) (<-chan Message, error) {
+	limiter := r.limiterFor(req.Name)
+
+	reservation := limiter.Reserve()
+	if !reservation.OK() {
+		return nil, fmt.Errorf("log query for function %q exceeds the rate limiter burst size", req.Name)
+	}
+
+	if delay := reservation.Delay(); delay > 0 {
+		if delay > longThrottleLatency {
+			reservation.Cancel()
+			log.Printf("RateLimitedRequestor: throttling log query for function %q, retry after %s\n", req.Name, delay)
+			return nil, &ThrottledError{RetryAfter: delay}
+		}
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			reservation.Cancel()
+			return nil, ctx.Err()
+		}
+	}
+
+	return r.inner.Query(ctx, req)
+}
+
+func (r *rateLimitedRequestor) limiterFor(function string) *rate.Limiter {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	limiter, ok := r.limiters[function]
+	if !ok {
+		limiter = rate.NewLimiter(rate.Limit(r.qps), r.burst)
+		r.limiters[function] = limiter
+	}
+
+	return limiter
+}
+
+// RetryPolicy configures the exponential backoff used by RetryingRequestor.
+type RetryPolicy struct {
+	// MaxRetries is the maximum number of times a failed Query is retried before giving up.
+	MaxRetries int
+	// BaseDelay is the delay before the first retry.
+	BaseDelay time.Duration
+	// MaxDelay caps the backoff delay between retries.
+	MaxDelay time.Duration
+}
+
+// DefaultRetryPolicy is a sensible backoff policy for transient upstream log store failures.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxRetries: 5,
+	BaseDelay:  200 * time.Millisecond,
+	MaxDelay:   10 * time.Second,
+}
+
+// retryingRequestor wraps a Requestor, transparently re-issuing Query on transient errors.
+type retryingRequestor struct {
+	inner  Requestor
+	policy RetryPolicy
+}
+
+// RetryingRequestor wraps inner so that a failing Query is retried with exponential backoff and
+// jitter, resuming from the timestamp of the last message successfully forwarded to the caller.
+// MaxRetries bounds consecutive failures; once inner.Query succeeds again the counter resets,
+// since a successful (re)connection proves the backend is healthy again. For a Request.Follow
+// query, the channel closing without the caller's context being canceled is also treated as a
+// backend hiccup and reconnected indefinitely, since a tail is not expected to end on its own and
+// each successful reconnect resets the same counter; a non-Follow query instead treats that same
+// closure as normal completion. This lets streams survive backend hiccups, mid-stream or before
+// the first message, without duplicating output to the client.
+//
+// A *ThrottledError from inner is never retried: it is returned immediately from Query so that,
+// when inner is a RateLimitedRequestor, the caller can still surface the 429/Retry-After response
+// instead of it being silently absorbed by the retry loop.
+func RetryingRequestor(inner Requestor, policy RetryPolicy) Requestor {
+	return &retryingRequestor{inner: inner, policy: policy}
+}
+
+func (r *retryingRequestor) Filter(req Request, msg Message) bool {
+	return r.inner.Filter(req, msg)
+}
+
+func (r *retryingRequestor) Query(ctx context.Context, req Request) (<-chan Message, error) {
+	currentReq := req
+	attempt := 0
+
+	// Connect synchronously, with retries, before returning to the caller. This is what lets a
+	// *ThrottledError (or any other non-retryable failure) be returned directly from Query,
+	// instead of being swallowed by a background goroutine that always returns (out, nil).
+	messages, err := r.connect(ctx, &currentReq, &attempt)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(chan Message)
+
+	go func() {
+		defer close(out)
+
+		for {
+			for msg := range messages {
+				select {
+				case out <- msg:
+					lastSeen := msg.Timestamp
+					currentReq.Since = &lastSeen
+				case <-ctx.Done():
+					return
+				}
+			}
+
+			if ctx.Err() != nil {
+				return
+			}
+
+			if !currentReq.Follow {
+				// the upstream channel closed without an error and this was not a follow
+				// request, so the query has run to completion.
+				return
+			}
+
+			delay := r.backoff(attempt)
+			attempt++
+			log.Printf("RetryingRequestor: follow log query for function %q closed unexpectedly, reconnecting in %s\n", req.Name, delay)
+			select {
+			case <-time.After(delay):
+			case <-ctx.Done():
+				return
+			}
+
+			messages, err = r.connect(ctx, &currentReq, &attempt)
+			if err != nil {
+				log.Printf("RetryingRequestor: giving up on follow log query for function %q: %s\n", req.Name, err)
+				return
+			}
+		}
+	}()
+
+	return out, nil
+}
+
+// connect calls r.inner.Query, retrying transient errors with exponential backoff until it
+// succeeds or attempt reaches r.policy.MaxRetries. A *ThrottledError is never retried, since it
+// is a signal from the rate limiter, not a transient backend failure, and the caller needs to see
+// it immediately to respond with a 429/Retry-After. On success, attempt is reset to 0, in place,
+// so the next failure streak starts counting from zero again.
+func (r *retryingRequestor) connect(ctx context.Context, currentReq *Request, attempt *int) (<-chan Message, error) {
+	for {
+		messages, err := r.inner.Query(ctx, *currentReq)
+		if err == nil {
+			*attempt = 0
+			return messages, nil
+		}
+
+		var throttled *ThrottledError
+		if errors.As(err, &throttled) {
+			return nil, err
+		}
+
+		if ctx.Err() != nil || *attempt >= r.policy.MaxRetries {
+			return nil, err
+		}
+
+		delay := r.backoff(*attempt)
+		*attempt++
+		log.Printf("RetryingRequestor: log query for function %q failed, retrying in %s: %s\n", currentReq.Name, delay, err)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// backoff returns the exponential backoff delay with jitter for the given retry attempt.
+func (r *retryingRequestor) backoff(attempt int) time.Duration {
+	delay := r.policy.BaseDelay << attempt
+	if delay <= 0 || delay > r.policy.MaxDelay {
+		delay = r.policy.MaxDelay
+	}
+
+	jitter := time.Duration(rand.Int63n(int64(delay)/2 + 1))
+	return delay/2 + jitter
+}
@@ -0,0 +1,210 @@
+package logs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// countingRequestor fails the first failCount calls to Query, then succeeds with the given
+// messages, recording the Since value it was called with on each attempt.
+type countingRequestor struct {
+	failCount int
+	messages  []Message
+	seenSince []*time.Time
+}
+
+func (r *countingRequestor) Filter(Request, Message) bool { return true }
+
+func (r *countingRequestor) Query(ctx context.Context, req Request) (<-chan Message, error) {
+	r.seenSince = append(r.seenSince, req.Since)
+
+	if len(r.seenSince) <= r.failCount {
+		return nil, errors.New("transient upstream failure")
+	}
+
+	out := make(chan Message, len(r.messages))
+	for _, msg := range r.messages {
+		out <- msg
+	}
+	close(out)
+
+	return out, nil
+}
+
+func Test_RetryingRequestor_RetriesAndResumes(t *testing.T) {
+	inner := &countingRequestor{
+		failCount: 2,
+		messages:  []Message{{Name: "foobar", Text: "hello"}},
+	}
+
+	requestor := RetryingRequestor(inner, RetryPolicy{
+		MaxRetries: 5,
+		BaseDelay:  time.Millisecond,
+		MaxDelay:   10 * time.Millisecond,
+	})
+
+	messages, err := requestor.Query(context.Background(), Request{Name: "foobar"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	var got []Message
+	for msg := range messages {
+		got = append(got, msg)
+	}
+
+	if len(got) != 1 || got[0].Text != "hello" {
+		t.Errorf("expected to receive the message after retrying, got: %v", got)
+	}
+
+	if len(inner.seenSince) != 3 {
+		t.Errorf("expected 3 attempts (2 failures + 1 success), got: %d", len(inner.seenSince))
+	}
+}
+
+// flakyFollowRequestor serves each entry in batches on successive calls to Query, as if the
+// backend's stream were hiccuping mid-tail. Once batches are exhausted, it blocks until ctx is
+// canceled, as a real follow query would while waiting for new log lines.
+type flakyFollowRequestor struct {
+	batches [][]Message
+	calls   int
+}
+
+func (r *flakyFollowRequestor) Filter(Request, Message) bool { return true }
+
+func (r *flakyFollowRequestor) Query(ctx context.Context, req Request) (<-chan Message, error) {
+	idx := r.calls
+	r.calls++
+
+	if idx >= len(r.batches) {
+		out := make(chan Message)
+		go func() {
+			<-ctx.Done()
+			close(out)
+		}()
+		return out, nil
+	}
+
+	out := make(chan Message, len(r.batches[idx]))
+	for _, msg := range r.batches[idx] {
+		out <- msg
+	}
+	close(out)
+
+	return out, nil
+}
+
+func Test_RetryingRequestor_ReconnectsFollowStreamOnUnexpectedClose(t *testing.T) {
+	inner := &flakyFollowRequestor{batches: [][]Message{
+		{{Text: "first"}},
+		{{Text: "second"}},
+	}}
+
+	requestor := RetryingRequestor(inner, RetryPolicy{
+		MaxRetries: 5,
+		BaseDelay:  time.Millisecond,
+		MaxDelay:   10 * time.Millisecond,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	messages, err := requestor.Query(ctx, Request{Name: "foobar", Follow: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	var got []string
+	got = append(got, (<-messages).Text)
+	got = append(got, (<-messages).Text)
+
+	cancel()
+	for range messages {
+		// drain until the goroutine observes ctx.Done and closes the channel
+	}
+
+	if len(got) != 2 || got[0] != "first" || got[1] != "second" {
+		t.Errorf("expected the stream to reconnect across the mid-stream hiccup and deliver both batches, got: %v", got)
+	}
+}
+
+func Test_RetryingRequestor_ResetsBudgetAfterSuccessfulReconnect(t *testing.T) {
+	// 4 consecutive successful reconnects, each closing immediately, with MaxRetries set to 2:
+	// if the budget were shared across the stream's whole lifetime instead of resetting on each
+	// successful reconnect, the query would give up long before the 4th batch.
+	batches := make([][]Message, 4)
+	for i := range batches {
+		batches[i] = []Message{{Text: fmt.Sprintf("batch-%d", i)}}
+	}
+	inner := &flakyFollowRequestor{batches: batches}
+
+	requestor := RetryingRequestor(inner, RetryPolicy{
+		MaxRetries: 2,
+		BaseDelay:  time.Millisecond,
+		MaxDelay:   10 * time.Millisecond,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	messages, err := requestor.Query(ctx, Request{Name: "foobar", Follow: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	var got []string
+	for i := 0; i < len(batches); i++ {
+		got = append(got, (<-messages).Text)
+	}
+
+	cancel()
+	for range messages {
+		// drain until the goroutine observes ctx.Done and closes the channel
+	}
+
+	if len(got) != len(batches) {
+		t.Fatalf("expected %d reconnects to all succeed, got: %v", len(batches), got)
+	}
+	for i, text := range got {
+		if text != fmt.Sprintf("batch-%d", i) {
+			t.Errorf("expected batch-%d, got: %s", i, text)
+		}
+	}
+}
+
+func Test_RetryingRequestor_SurfacesThrottledErrorWithoutRetrying(t *testing.T) {
+	inner := &countingRequestor{messages: []Message{{Name: "foobar", Text: "hello"}}}
+	requestor := RetryingRequestor(RateLimitedRequestor(inner, 1, 1), RetryPolicy{
+		MaxRetries: 5,
+		BaseDelay:  time.Millisecond,
+		MaxDelay:   10 * time.Millisecond,
+	})
+
+	if _, err := requestor.Query(context.Background(), Request{Name: "foobar"}); err != nil {
+		t.Fatalf("first query should consume the burst token without error: %s", err)
+	}
+
+	_, err := requestor.Query(context.Background(), Request{Name: "foobar"})
+	var throttled *ThrottledError
+	if !errors.As(err, &throttled) {
+		t.Fatalf("expected a *ThrottledError to be returned immediately once the burst is exhausted, got: %v", err)
+	}
+
+	if len(inner.seenSince) != 1 {
+		t.Errorf("expected the retry loop not to retry a throttled query, inner was called %d times", len(inner.seenSince))
+	}
+}
+
+func Test_RateLimitedRequestor_ThrottlesBurst(t *testing.T) {
+	inner := &countingRequestor{messages: []Message{{Name: "foobar", Text: "hello"}}}
+	requestor := RateLimitedRequestor(inner, 1, 1)
+
+	if _, err := requestor.Query(context.Background(), Request{Name: "foobar"}); err != nil {
+		t.Fatalf("first query should consume the burst token without error: %s", err)
+	}
+
+	_, err := requestor.Query(context.Background(), Request{Name: "foobar"})
+	var throttled *ThrottledError
+	if !errors.As(err, &throttled) {
+		t.Errorf("expected a *ThrottledError once the burst is exhausted, got: %v", err)
+	}
+}
@@ -0,0 +1,164 @@
+package logs
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const (
+	// websocketWriteWait is the time allowed to write a message to the peer.
+	websocketWriteWait = 10 * time.Second
+	// websocketPongWait is the time allowed to read the next pong message from the peer.
+	websocketPongWait = 60 * time.Second
+	// websocketPingPeriod sends pings to the peer with this period, must be less than websocketPongWait.
+	websocketPingPeriod = (websocketPongWait * 9) / 10
+)
+
+// NewLogWebsocketHandler creates an http.HandlerFunc that upgrades the request to a websocket
+// connection and streams Messages from the supplied Requestor as JSON text frames. It keeps the
+// connection alive with server-side ping/pong and cancels the underlying query as soon as the
+// client closes the connection. Passing WithRateLimit and/or WithRetryPolicy composes the
+// corresponding middleware around requestor, the same way it does for NewLogHandlerFunc. Log
+// lines are written with the default Logger returned by NewStdLogger, unless overridden with
+// WithLogger; see also NewLogWebsocketHandlerWithOptions.
+func NewLogWebsocketHandler(requestor Requestor, upgrader *websocket.Upgrader, opts ...Option) http.HandlerFunc {
+	return newLogWebsocketHandler(requestor, upgrader, opts)
+}
+
+// NewLogWebsocketHandlerWithOptions is equivalent to NewLogWebsocketHandler, but records
+// Prometheus metrics and an OpenTelemetry span, as configured on observability, for every request.
+func NewLogWebsocketHandlerWithOptions(requestor Requestor, upgrader *websocket.Upgrader, observability *Observability, opts ...Option) http.HandlerFunc {
+	return newLogWebsocketHandler(requestor, upgrader, append(opts, WithObservability(observability)))
+}
+
+func newLogWebsocketHandler(requestor Requestor, upgrader *websocket.Upgrader, opts []Option) http.HandlerFunc {
+	requestor, logger, observability := resolveOptions(requestor, opts)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Body != nil {
+			defer r.Body.Close()
+		}
+
+		ctx, ro := startRequest(r.Context(), observability)
+
+		reqLogger := logger.With(map[string]interface{}{"remote_addr": r.RemoteAddr})
+
+		logRequest, err := parseRequest(r)
+		if err != nil {
+			ro.end(reasonParseError, 0)
+			http.Error(w, "could not parse the log request", http.StatusUnprocessableEntity)
+			return
+		}
+		ro.setFunction(logRequest.Name)
+		ro.event("parseRequest")
+
+		reqLogger = reqLogger.With(map[string]interface{}{
+			"function": logRequest.Name,
+			"instance": logRequest.Instance,
+			"limit":    logRequest.Limit,
+		})
+
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			reqLogger.With(map[string]interface{}{"err": err}).Errorf("LogHandler: failed to upgrade websocket connection")
+			ro.end(reasonUpgradeError, 0)
+			return
+		}
+		defer conn.Close()
+
+		ctx, cancelQuery := context.WithCancel(ctx)
+		defer cancelQuery()
+
+		messages, err := requestor.Query(ctx, logRequest)
+		ro.event("query")
+		if err != nil {
+			var throttled *ThrottledError
+			if errors.As(err, &throttled) {
+				reqLogger.Warnf("LogHandler: throttled function log request")
+				ro.end(reasonThrottled, 0)
+				conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "function log request throttled"))
+				return
+			}
+
+			reqLogger.With(map[string]interface{}{"err": err}).Errorf("LogHandler: function log request failed")
+			ro.end(reasonQueryError, 0)
+			conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseInternalServerErr, "function log request failed"))
+			return
+		}
+
+		// closed is signaled once the client sends a close frame or the connection otherwise errors,
+		// which lets us cancel the in-flight query and stop writing.
+		closed := make(chan struct{})
+		conn.SetReadDeadline(time.Now().Add(websocketPongWait))
+		conn.SetPongHandler(func(string) error {
+			conn.SetReadDeadline(time.Now().Add(websocketPongWait))
+			return nil
+		})
+		go func() {
+			defer close(closed)
+			for {
+				if _, _, err := conn.ReadMessage(); err != nil {
+					return
+				}
+			}
+		}()
+
+		ticker := time.NewTicker(websocketPingPeriod)
+		defer ticker.Stop()
+
+		sent := 0
+		for messages != nil {
+			select {
+			case <-closed:
+				reqLogger.With(map[string]interface{}{"sent": sent}).Infof("LogHandler: client closed the websocket connection")
+				ro.end(reasonClientClosed, sent)
+				return
+			case <-ticker.C:
+				conn.SetWriteDeadline(time.Now().Add(websocketWriteWait))
+				if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+					reqLogger.With(map[string]interface{}{"err": err}).Errorf("LogHandler: failed to ping websocket client")
+					ro.end(reasonClientClosed, sent)
+					return
+				}
+			case msg, ok := <-messages:
+				if !ok {
+					reqLogger.With(map[string]interface{}{"sent": sent}).Infof("LogHandler: end of log stream")
+					ro.end(reasonUpstreamEOF, sent)
+					messages = nil
+					return
+				}
+				if !requestor.Filter(logRequest, msg) {
+					continue
+				}
+				if !PatternFilter(logRequest, msg) {
+					continue
+				}
+				if !matchesStream(logRequest, msg) || !inTimeWindow(logRequest, msg) {
+					continue
+				}
+				msg = withTimestamp(logRequest, msg)
+
+				conn.SetWriteDeadline(time.Now().Add(websocketWriteWait))
+				if err := conn.WriteJSON(msg); err != nil {
+					reqLogger.With(map[string]interface{}{"err": err}).Errorf("LogHandler: failed to write log message to websocket")
+					ro.end(reasonEncodeError, sent)
+					return
+				}
+
+				sent++
+				ro.event("flush", attribute.Int("sent", sent))
+
+				if logRequest.Limit > 0 && sent >= logRequest.Limit {
+					reqLogger.With(map[string]interface{}{"sent": sent}).Infof("LogHandler: reached message limit")
+					ro.end(reasonLimitReached, sent)
+					return
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package logs
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// websocketTestRequestor streams the given messages and then blocks until ctx is canceled, as a
+// real follow query would while waiting for the client to close the connection.
+type websocketTestRequestor struct {
+	messages []Message
+}
+
+func (r *websocketTestRequestor) Filter(Request, Message) bool { return true }
+
+func (r *websocketTestRequestor) Query(ctx context.Context, req Request) (<-chan Message, error) {
+	out := make(chan Message, len(r.messages))
+	for _, msg := range r.messages {
+		out <- msg
+	}
+
+	go func() {
+		<-ctx.Done()
+		close(out)
+	}()
+
+	return out, nil
+}
+
+func Test_NewLogWebsocketHandler(t *testing.T) {
+	requestor := &websocketTestRequestor{
+		messages: []Message{{Name: "foobar", Text: "hello"}},
+	}
+
+	server := httptest.NewServer(NewLogWebsocketHandler(requestor, &websocket.Upgrader{}))
+	defer server.Close()
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/?name=foobar"
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("failed to dial websocket: %s", err)
+	}
+	defer conn.Close()
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	var msg Message
+	if err := conn.ReadJSON(&msg); err != nil {
+		t.Fatalf("failed to read message: %s", err)
+	}
+
+	if msg.Name != "foobar" || msg.Text != "hello" {
+		t.Errorf("expected message {foobar hello}, got: %+v", msg)
+	}
+}
+
+func Test_NewLogWebsocketHandler_Throttled(t *testing.T) {
+	requestor := &websocketTestRequestor{messages: []Message{{Name: "foobar", Text: "hello"}}}
+
+	server := httptest.NewServer(NewLogWebsocketHandler(requestor, &websocket.Upgrader{}, WithRateLimit(1, 1)))
+	defer server.Close()
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/?name=foobar"
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("failed to dial websocket: %s", err)
+	}
+	defer conn.Close()
+
+	conn2, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("failed to dial websocket: %s", err)
+	}
+	defer conn2.Close()
+
+	conn2.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, _, err = conn2.ReadMessage()
+
+	closeErr, ok := err.(*websocket.CloseError)
+	if !ok {
+		t.Fatalf("expected a close error once the rate limiter burst is exhausted, got: %v", err)
+	}
+	if closeErr.Code != websocket.CloseTryAgainLater {
+		t.Errorf("expected close code %d, got: %d", websocket.CloseTryAgainLater, closeErr.Code)
+	}
+}
+
+func Test_NewLogWebsocketHandlerWithOptions_RecordsMetrics(t *testing.T) {
+	requestor := &websocketTestRequestor{
+		messages: []Message{{Name: "foobar", Text: "hello"}},
+	}
+	metrics := NewMetrics()
+	observability := &Observability{Metrics: metrics}
+
+	server := httptest.NewServer(NewLogWebsocketHandlerWithOptions(requestor, &websocket.Upgrader{}, observability, WithRateLimit(1, 1)))
+	defer server.Close()
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/?name=foobar"
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("failed to dial websocket: %s", err)
+	}
+	defer conn.Close()
+
+	// consume the rate limiter's single burst token so the second dial below is throttled, which
+	// the handler records and closes synchronously, without depending on timing of the first
+	// connection's ping/close bookkeeping.
+	conn2, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("failed to dial websocket: %s", err)
+	}
+	defer conn2.Close()
+
+	conn2.SetReadDeadline(time.Now().Add(5 * time.Second))
+	conn2.ReadMessage()
+
+	metric := &dto.Metric{}
+	counter, err := metrics.RequestsTotal.GetMetricWithLabelValues("foobar", reasonThrottled)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := counter.(prometheus.Metric).Write(metric); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if metric.GetCounter().GetValue() != 1 {
+		t.Errorf("expected faas_logs_requests_total{foobar,throttled} to be 1, got: %v", metric.GetCounter().GetValue())
+	}
+}
+
+func Test_NewLogWebsocketHandler_ParseError(t *testing.T) {
+	requestor := &websocketTestRequestor{}
+
+	server := httptest.NewServer(NewLogWebsocketHandler(requestor, &websocket.Upgrader{}))
+	defer server.Close()
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/?limit=notanumber"
+	_, resp, err := websocket.DefaultDialer.Dial(url, nil)
+	if err == nil {
+		t.Fatal("expected the websocket handshake to fail for an unparseable request")
+	}
+
+	if resp == nil || resp.StatusCode != 422 {
+		t.Errorf("expected status 422, got: %v", resp)
+	}
+}